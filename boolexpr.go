@@ -0,0 +1,109 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprParser evaluates a boolean expression for BoolExpr.
+// It evaluates every operand, without short-circuiting,
+// so that errors anywhere in the expression are reported.
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func evalBoolExpr(s string) (bool, error) {
+	p := &exprParser{s: s}
+	v, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return false, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return v, nil
+}
+
+func (p *exprParser) or() (bool, error) {
+	v, err := p.and()
+	for err == nil && p.consume("||") {
+		var w bool
+		w, err = p.and()
+		v = v || w
+	}
+	return v, err
+}
+
+func (p *exprParser) and() (bool, error) {
+	v, err := p.unary()
+	for err == nil && p.consume("&&") {
+		var w bool
+		w, err = p.unary()
+		v = v && w
+	}
+	return v, err
+}
+
+func (p *exprParser) unary() (bool, error) {
+	switch {
+	case p.consume("!"):
+		v, err := p.unary()
+		return !v, err
+	case p.consume("("):
+		v, err := p.or()
+		if err == nil && !p.consume(")") {
+			err = p.errorf("missing )")
+		}
+		return v, err
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isIdentByte(p.s[p.pos], p.pos > start) {
+		p.pos++
+	}
+	if p.pos == start {
+		if p.pos == len(p.s) {
+			return false, p.errorf("unexpected end of expression")
+		}
+		return false, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	ident := p.s[start:p.pos]
+	s := getenv(ident)
+	if s == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", ident, err)
+	}
+	return v, nil
+}
+
+// consume skips white space, then reports whether
+// the input continues with tok, advancing past it if so.
+func (p *exprParser) consume(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q: offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func isIdentByte(c byte, notFirst bool) bool {
+	return c == '_' ||
+		'A' <= c && c <= 'Z' ||
+		'a' <= c && c <= 'z' ||
+		notFirst && '0' <= c && c <= '9'
+}
@@ -3,10 +3,28 @@
 package env // import "github.com/kr/env"
 
 import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"math"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,7 +34,7 @@ import (
 // diagnostic message to the log and calls os.Exit(1).
 // If name isn't in the environment, it returns value.
 func Int(name string, value int) int {
-	if s := os.Getenv(name); s != "" {
+	if s := getenv(name); s != "" {
 		var err error
 		value, err = strconv.Atoi(s)
 		if err != nil {
@@ -33,7 +51,7 @@ func Int(name string, value int) int {
 // diagnostic message to the log and calls os.Exit(1).
 // If name isn't in the environment, it returns value.
 func Duration(name string, value time.Duration) time.Duration {
-	if s := os.Getenv(name); s != "" {
+	if s := getenv(name); s != "" {
 		var err error
 		value, err = time.ParseDuration(s)
 		if err != nil {
@@ -57,7 +75,7 @@ func Time(name, format, value string) time.Time {
 	if err != nil {
 		panic(err)
 	}
-	if s := os.Getenv(name); s != "" {
+	if s := getenv(name); s != "" {
 		v, err = time.Parse(format, s)
 		if err != nil {
 			log.Println(name, err)
@@ -79,7 +97,7 @@ func URL(name string, value string) *url.URL {
 	if err != nil {
 		panic(err)
 	}
-	if s := os.Getenv(name); s != "" {
+	if s := getenv(name); s != "" {
 		v, err = url.Parse(s)
 		if err != nil {
 			log.Println(name, err)
@@ -92,8 +110,2204 @@ func URL(name string, value string) *url.URL {
 // String returns the value of the named environment variable.
 // If name isn't in the environment or is empty, it returns value.
 func String(name string, value string) string {
-	if s := os.Getenv(name); s != "" {
+	if s := getenv(name); s != "" {
 		value = s
 	}
 	return value
 }
+
+// Slice returns the value of the named environment variable,
+// split on sep, with each element trimmed of leading and
+// trailing white space and interpreted using parse.
+// If parse returns an error for any element, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func Slice[T any](name, sep string, value []T, parse func(string) (T, error)) []T {
+	if s := getenv(name); s != "" {
+		parts := strings.Split(s, sep)
+		v := make([]T, len(parts))
+		for i, p := range parts {
+			x, err := parse(strings.TrimSpace(p))
+			if err != nil {
+				log.Println(name, err)
+				os.Exit(1)
+			}
+			v[i] = x
+		}
+		return v
+	}
+	return value
+}
+
+// MediaType returns the value of the named environment variable,
+// interpreted as a media type and its parameters
+// (using mime.ParseMediaType).
+// If there is an error parsing the environment value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, MediaType returns the result
+// of parsing the given value.
+// MediaType panics if there is an error parsing the given value.
+func MediaType(name string, value string) (mediatype string, params map[string]string) {
+	mediatype, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		mediatype, params, err = mime.ParseMediaType(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return mediatype, params
+}
+
+// Unit returns the value of the named environment variable,
+// interpreted as a number followed by a unit token,
+// such as "250ms", and scaled by that unit's factor in units.
+// The unit token is everything after the leading number,
+// so it may contain digits, as in "5m2".
+// A value with no unit token uses the factor for "",
+// if units has one.
+// If there is an error parsing the value or the unit isn't in units,
+// it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func Unit(name string, units map[string]float64, value float64) float64 {
+	if s := getenv(name); s != "" {
+		num, unit := splitUnit(s)
+		f, ok := units[unit]
+		if !ok {
+			log.Println(name, fmt.Errorf("unknown unit %q in %q", unit, s))
+			os.Exit(1)
+		}
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = n * f
+	}
+	return value
+}
+
+// splitUnit splits s after its leading number, which is an optional
+// sign, digits with an optional decimal point, and an optional
+// exponent such as "e3", returning the number and the unit
+// token that follows, each trimmed of surrounding white space.
+// The unit token may itself contain digits, as in "5m2".
+func splitUnit(s string) (num, unit string) {
+	t := strings.TrimSpace(s)
+	i := 0
+	if i < len(t) && (t[i] == '+' || t[i] == '-') {
+		i++
+	}
+	i += digitsLen(t[i:])
+	if i < len(t) && t[i] == '.' {
+		i++
+		i += digitsLen(t[i:])
+	}
+	if i < len(t) && (t[i] == 'e' || t[i] == 'E') {
+		// Only an exponent if digits follow,
+		// so that "1E" can still mean a unit E.
+		j := i + 1
+		if j < len(t) && (t[j] == '+' || t[j] == '-') {
+			j++
+		}
+		if n := digitsLen(t[j:]); n > 0 {
+			i = j + n
+		}
+	}
+	return t[:i], strings.TrimSpace(t[i:])
+}
+
+// digitsLen returns the number of leading ASCII digits in s.
+func digitsLen(s string) int {
+	n := 0
+	for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+func isNumberRune(r rune) bool {
+	return '0' <= r && r <= '9' || r == '.'
+}
+
+// IPSlice returns the value of the named environment variable,
+// split on commas, with each element trimmed of leading and
+// trailing white space and interpreted as a net.IP
+// (using net.ParseIP).
+// If any element is not a valid IP address, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, IPSlice returns
+// the result of parsing the elements of value.
+// IPSlice panics if any element of value is not a valid IP address.
+func IPSlice(name string, value []string) []net.IP {
+	v := make([]net.IP, len(value))
+	for i, s := range value {
+		ip, err := parseIP(s)
+		if err != nil {
+			panic(err)
+		}
+		v[i] = ip
+	}
+	return Slice(name, ",", v, parseIP)
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	return ip, nil
+}
+
+// BoolPtr returns a pointer to the value of the named
+// environment variable, interpreted as a bool
+// (using strconv.ParseBool).
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns nil,
+// letting callers tell an unset variable from an explicit false.
+func BoolPtr(name string) *bool {
+	v, ok := lookupBool(name)
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// lookupBool returns the value of the named environment variable,
+// interpreted as a bool (using strconv.ParseBool),
+// and whether it was set to a non-empty value.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+func lookupBool(name string) (v, ok bool) {
+	s := getenv(name)
+	if s == "" {
+		return false, false
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Println(name, err)
+		os.Exit(1)
+	}
+	return v, true
+}
+
+// Weighted is a value with an associated integer weight,
+// as returned by WeightedSlice.
+type Weighted struct {
+	Value  string
+	Weight int
+}
+
+// WeightedSlice returns the value of the named environment variable,
+// interpreted as a comma-separated list of value=weight pairs,
+// such as "a=3,b=1".
+// An element with no "=weight" part has weight 1.
+// If any element has an empty value, or any weight is not
+// a non-negative integer, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func WeightedSlice(name string, value []Weighted) []Weighted {
+	return Slice(name, ",", value, parseWeighted)
+}
+
+func parseWeighted(s string) (Weighted, error) {
+	v, w, ok := strings.Cut(s, "=")
+	e := Weighted{Value: strings.TrimSpace(v), Weight: 1}
+	if e.Value == "" {
+		return Weighted{}, fmt.Errorf("%q: empty value", s)
+	}
+	if ok {
+		n, err := strconv.Atoi(strings.TrimSpace(w))
+		if err != nil {
+			return Weighted{}, fmt.Errorf("%q: %v", s, err)
+		}
+		if n < 0 {
+			return Weighted{}, fmt.Errorf("%q: negative weight", s)
+		}
+		e.Weight = n
+	}
+	return e, nil
+}
+
+// Port returns the value of the named environment variable,
+// interpreted as a TCP or UDP port number in the range 1 to 65535.
+// Port 0, meaning an ephemeral port, is rejected;
+// use Int to allow it.
+// If there is an error parsing the value or it is out of range,
+// it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+// Port panics if value is out of range.
+func Port(name string, value int) int {
+	if err := checkPort(value); err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = strconv.Atoi(s)
+		if err == nil {
+			err = checkPort(value)
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+func checkPort(n int) error {
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("port %d out of range", n)
+	}
+	return nil
+}
+
+// A Constraint is a set of version comparisons,
+// as returned by VersionConstraint.
+type Constraint struct {
+	terms []versionTerm
+}
+
+type versionTerm struct {
+	op string
+	v  [3]int
+}
+
+// Check reports whether version satisfies every comparison in c.
+// It returns false if version is not a valid version.
+func (c Constraint) Check(version string) bool {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.terms {
+		n := compareVersions(v, t.v)
+		var ok bool
+		switch t.op {
+		case ">=":
+			ok = n >= 0
+		case ">":
+			ok = n > 0
+		case "<=":
+			ok = n <= 0
+		case "<":
+			ok = n < 0
+		case "=":
+			ok = n == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionConstraint returns the value of the named environment variable,
+// interpreted as a version constraint such as ">=1.2.0 <2.0.0".
+// A constraint is a list of comparisons separated by spaces or
+// commas, all of which must hold.
+// Each comparison is one of the operators >=, >, <=, <, or =
+// followed by a version; a version with no operator means =.
+// Versions have the form major.minor.patch, with an optional
+// leading "v"; missing minor or patch numbers are taken as 0,
+// and any prerelease or build suffix is ignored.
+// If there is an error parsing the environment value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, VersionConstraint returns the
+// Constraint that results from parsing the given value.
+// VersionConstraint panics if there is an error parsing the given value.
+func VersionConstraint(name string, value string) Constraint {
+	v, err := parseConstraint(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseConstraint(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.Trim(f, "<>=") == "" && i+1 < len(fields) {
+			// Operator separated from its version by a space.
+			i++
+			f += fields[i]
+		}
+		ver := strings.TrimLeft(f, "<>=")
+		op := f[:len(f)-len(ver)]
+		switch op {
+		case "":
+			op = "="
+		case ">=", ">", "<=", "<", "=":
+		default:
+			return Constraint{}, fmt.Errorf("invalid operator %q in constraint %q", op, s)
+		}
+		v, err := parseVersion(ver)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("constraint %q: %v", s, err)
+		}
+		c.terms = append(c.terms, versionTerm{op, v})
+	}
+	if len(c.terms) == 0 {
+		return Constraint{}, fmt.Errorf("empty version constraint")
+	}
+	return c, nil
+}
+
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	t := strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(t, "-+"); i >= 0 {
+		t = t[:i]
+	}
+	parts := strings.Split(t, ".")
+	if len(parts) > len(v) {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// A ByteMode selects how BytesMode interprets size suffixes.
+type ByteMode int
+
+const (
+	// SI accepts decimal suffixes: kB (or KB), MB, GB, TB, PB, EB,
+	// each a power of 1000.
+	SI ByteMode = iota
+
+	// IEC accepts binary suffixes: KiB, MiB, GiB, TiB, PiB, EiB,
+	// each a power of 1024.
+	IEC
+)
+
+var byteUnits = map[ByteMode]map[string]int64{
+	SI: {
+		"": 1, "B": 1,
+		"kB": 1e3, "KB": 1e3,
+		"MB": 1e6,
+		"GB": 1e9,
+		"TB": 1e12,
+		"PB": 1e15,
+		"EB": 1e18,
+	},
+	IEC: {
+		"": 1, "B": 1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+		"PiB": 1 << 50,
+		"EiB": 1 << 60,
+	},
+}
+
+// BytesMode returns the value of the named environment variable,
+// interpreted as a byte count with an optional size suffix,
+// such as "512MB" or "1.5GiB".
+// Only the suffixes accepted by mode are recognized,
+// so "1MB" is always 1000000 bytes in SI mode
+// and is an error in IEC mode.
+// A number with no suffix, or the suffix B, is a count of bytes.
+// If there is an error parsing the value, the suffix isn't
+// recognized, or the result overflows an int64, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func BytesMode(name string, mode ByteMode, value int64) int64 {
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = parseScaled(s, byteUnits[mode])
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// parseScaled parses s as a non-negative number with a unit suffix
+// from units, truncating the scaled result to an integer.
+// Integers are scaled exactly; only a number with a fraction
+// or exponent goes through floating point.
+func parseScaled(s string, units map[string]int64) (int64, error) {
+	num, unit := splitUnit(s)
+	m, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown suffix %q in %q", unit, s)
+	}
+	if !strings.ContainsAny(num, ".eE") {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 || n > math.MaxInt64/m {
+			return 0, fmt.Errorf("%q out of range", s)
+		}
+		return n * m, nil
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	n *= float64(m)
+	if !(n >= 0 && n < 1<<63) {
+		return 0, fmt.Errorf("%q out of range", s)
+	}
+	return int64(n), nil
+}
+
+// StringPipe returns the value of the named environment variable,
+// or value if name isn't in the environment or is empty,
+// passed through each of steps in order.
+// If any step returns an error, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+func StringPipe(name, value string, steps ...func(string) (string, error)) string {
+	value = String(name, value)
+	for _, step := range steps {
+		var err error
+		value, err = step(value)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// Trim is a StringPipe step that removes leading and
+// trailing white space.
+func Trim(s string) (string, error) {
+	return strings.TrimSpace(s), nil
+}
+
+// Lower is a StringPipe step that maps s to lower case.
+func Lower(s string) (string, error) {
+	return strings.ToLower(s), nil
+}
+
+// Prefix returns a StringPipe step that fails
+// unless its input begins with prefix.
+func Prefix(prefix string) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if !strings.HasPrefix(s, prefix) {
+			return "", fmt.Errorf("%q does not begin with %q", s, prefix)
+		}
+		return s, nil
+	}
+}
+
+// RateLimit returns the value of the named environment variable,
+// interpreted as a rate of the form count/interval,
+// such as "100/s", "50/500ms", or "1000/m".
+// The interval is a duration (using time.ParseDuration);
+// a bare unit with no number, as in "/s", means one of that unit.
+// If there is an error parsing the environment value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, RateLimit returns the result
+// of parsing the given value.
+// RateLimit panics if there is an error parsing the given value.
+func RateLimit(name string, value string) (n int, per time.Duration) {
+	n, per, err := parseRate(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		n, per, err = parseRate(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return n, per
+}
+
+func parseRate(s string) (int, time.Duration, error) {
+	count, interval, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid rate %q: missing /interval", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q: bad count", s)
+	}
+	interval = strings.TrimSpace(interval)
+	if interval != "" && !isNumberRune(rune(interval[0])) {
+		interval = "1" + interval
+	}
+	per, err := time.ParseDuration(interval)
+	if err != nil || per <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q: bad interval", s)
+	}
+	return n, per, nil
+}
+
+// AllowDeny returns the values of the environment variables
+// prefix_ALLOW and prefix_DENY, each interpreted as a
+// comma-separated list.
+// Elements are trimmed of leading and trailing white space,
+// and empty elements are dropped.
+// A list is empty if its variable isn't in the environment.
+func AllowDeny(prefix string) (allow, deny []string) {
+	allow = splitList(getenv(prefix + "_ALLOW"))
+	deny = splitList(getenv(prefix + "_DENY"))
+	return allow, deny
+}
+
+// splitList splits s on commas, trims each element,
+// and drops empty elements.
+func splitList(s string) []string {
+	var v []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			v = append(v, e)
+		}
+	}
+	return v
+}
+
+// URLScheme is like URL, but it also requires
+// the URL's scheme to be one of allowed.
+// If the environment value can't be parsed or has a scheme
+// that isn't allowed, it prints a diagnostic message
+// to the log and calls os.Exit(1).
+// URLScheme panics if there is an error parsing the given value
+// or its scheme isn't allowed.
+func URLScheme(name string, value string, allowed ...string) *url.URL {
+	v, err := parseURLScheme(value, allowed)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseURLScheme(s, allowed)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseURLScheme(s string, allowed []string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, scheme := range allowed {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("URL %q: scheme %q not allowed", s, u.Scheme)
+}
+
+var deprecationWarned sync.Map // variable name -> bool
+
+// StringDeprecated returns the value of the environment variable
+// replacement, falling back to the deprecated variable name.
+// If name is set, StringDeprecated prints a warning to the log
+// pointing to replacement, at most once per process for each name.
+// If neither variable is in the environment or both are empty,
+// it returns value.
+func StringDeprecated(name, replacement, value string) string {
+	old := getenv(name)
+	if old != "" {
+		if _, warned := deprecationWarned.LoadOrStore(name, true); !warned {
+			log.Println(name, "is deprecated; use", replacement, "instead")
+		}
+		value = old
+	}
+	return String(replacement, value)
+}
+
+// DurationOrNever returns the value of the named environment variable,
+// interpreted as a time.Duration (using time.ParseDuration),
+// or reports that it is disabled.
+// The words "never", "off", and "disabled", in any case,
+// yield a zero duration and disabled set to true,
+// distinguishing them from an explicit "0".
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value and false.
+func DurationOrNever(name string, value time.Duration) (d time.Duration, disabled bool) {
+	s := getenv(name)
+	switch strings.ToLower(s) {
+	case "never", "off", "disabled":
+		return 0, true
+	}
+	return Duration(name, value), false
+}
+
+// Key returns the value of the named environment variable,
+// decoded as key material of exactly bytesLen bytes.
+// The value may be hex encoded or base64 encoded
+// (standard or URL alphabet, with or without padding).
+// A value of 2*bytesLen hex digits is taken as hex;
+// anything else is taken as base64.
+// If there is an error decoding the value or the decoded key
+// isn't bytesLen bytes long, it prints a diagnostic message
+// to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+// Key panics if value isn't bytesLen bytes long.
+func Key(name string, bytesLen int, value []byte) []byte {
+	if len(value) != bytesLen {
+		panic(fmt.Errorf("key is %d bytes, want %d", len(value), bytesLen))
+	}
+	if s := getenv(name); s != "" {
+		k, err := decodeKey(s, bytesLen)
+		if err == nil && len(k) != bytesLen {
+			err = fmt.Errorf("key is %d bytes, want %d", len(k), bytesLen)
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = k
+	}
+	return value
+}
+
+var keyEncodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+func decodeKey(s string, n int) ([]byte, error) {
+	if len(s) == 2*n {
+		if b, err := hex.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	for _, enc := range keyEncodings {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("key is neither hex nor base64")
+}
+
+// LazyInt returns a function that, on its first call,
+// reads the named environment variable as Int does
+// and caches the result for later calls.
+// Any error parsing the value is reported on that first call.
+func LazyInt(name string, value int) func() int {
+	return lazy(func() int { return Int(name, value) })
+}
+
+// LazyDuration returns a function that, on its first call,
+// reads the named environment variable as Duration does
+// and caches the result for later calls.
+// Any error parsing the value is reported on that first call.
+func LazyDuration(name string, value time.Duration) func() time.Duration {
+	return lazy(func() time.Duration { return Duration(name, value) })
+}
+
+// LazyURL returns a function that, on its first call,
+// reads the named environment variable as URL does
+// and caches the result for later calls.
+// Any error parsing the values is reported on that first call.
+func LazyURL(name string, value string) func() *url.URL {
+	return lazy(func() *url.URL { return URL(name, value) })
+}
+
+func lazy[T any](f func() T) func() T {
+	var (
+		once sync.Once
+		v    T
+	)
+	return func() T {
+		once.Do(func() { v = f() })
+		return v
+	}
+}
+
+// Signals returns the value of the named environment variable,
+// interpreted as a comma-separated list of signal names,
+// such as "SIGHUP,SIGTERM".
+// Names are matched without regard to case,
+// and the SIG prefix is optional.
+// The set of recognized names depends on the operating system.
+// If any name is not recognized, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func Signals(name string, value []os.Signal) []os.Signal {
+	return Slice(name, ",", value, parseSignal)
+}
+
+func parseSignal(s string) (os.Signal, error) {
+	k := strings.ToUpper(s)
+	if !strings.HasPrefix(k, "SIG") {
+		k = "SIG" + k
+	}
+	sig, ok := signalNames[k]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal %q", s)
+	}
+	return sig, nil
+}
+
+// Proxy returns the value of the named environment variable,
+// interpreted as a proxy URL (using url.Parse),
+// suitable for use with http.ProxyURL.
+// A value with no scheme, such as "proxy.example.com:3128",
+// is taken to be an http proxy.
+// If there is an error parsing the environment value or it
+// has no host, it prints a diagnostic message to the log
+// and calls os.Exit(1).
+// If name isn't in the environment, Proxy returns the *url.URL
+// that results from parsing the given value,
+// or nil if value is empty.
+// Proxy panics if there is an error parsing a non-empty given value.
+func Proxy(name string, value string) *url.URL {
+	var v *url.URL
+	if value != "" {
+		var err error
+		v, err = parseProxy(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if s := getenv(name); s != "" {
+		var err error
+		v, err = parseProxy(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", s)
+	}
+	return u, nil
+}
+
+// JSONMap returns the value of the named environment variable,
+// interpreted as a JSON object whose values have type T
+// (using json.Unmarshal).
+// If there is an error decoding the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func JSONMap[T any](name string, value map[string]T) map[string]T {
+	if s := getenv(name); s != "" {
+		var v map[string]T
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = v
+	}
+	return value
+}
+
+// IntEnum returns the value of the named environment variable,
+// interpreted as an int (using strconv.Atoi),
+// which must be one of allowed.
+// If there is an error parsing the value or it isn't in allowed,
+// it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+// IntEnum panics if value isn't in allowed.
+func IntEnum(name string, allowed []int, value int) int {
+	if !containsInt(allowed, value) {
+		panic(fmt.Errorf("%d not in %v", value, allowed))
+	}
+	v := Int(name, value)
+	if !containsInt(allowed, v) {
+		log.Println(name, fmt.Errorf("%d not in %v", v, allowed))
+		os.Exit(1)
+	}
+	return v
+}
+
+func containsInt(a []int, n int) bool {
+	for _, x := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+// BoolExpr returns the value of the named environment variable,
+// interpreted as a boolean expression over other environment
+// variables, such as "BETA && !LEGACY".
+// Each variable in the expression is interpreted as a bool
+// (using strconv.ParseBool); a variable that isn't in the
+// environment or is empty is false.
+// An expression is built from variable names, the operators
+// ! (not), && (and), and || (or), and parentheses for grouping.
+// ! binds tightest, then &&, then ||.
+// If there is a syntax error in the expression or an error parsing
+// a variable it refers to, BoolExpr prints a diagnostic message
+// to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func BoolExpr(name string, value bool) bool {
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = evalBoolExpr(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// StringSliceFunc returns the value of the named environment variable,
+// interpreted as a comma-separated list, with each element
+// checked by validate.
+// Elements are trimmed of leading and trailing white space,
+// and empty elements are dropped.
+// If validate returns an error for any element, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+// StringSliceFunc panics if validate returns an error
+// for any element of value.
+func StringSliceFunc(name string, value []string, validate func(string) error) []string {
+	for _, e := range value {
+		if err := validate(e); err != nil {
+			panic(fmt.Errorf("%q: %v", e, err))
+		}
+	}
+	if s := getenv(name); s != "" {
+		value = splitList(s)
+		for _, e := range value {
+			if err := validate(e); err != nil {
+				log.Println(name, fmt.Errorf("%q: %v", e, err))
+				os.Exit(1)
+			}
+		}
+	}
+	return value
+}
+
+// Language returns the value of the named environment variable,
+// interpreted as a BCP 47 language tag, such as "en-US",
+// and normalized to canonical form.
+// Underscores are accepted in place of hyphens,
+// as in "pt_BR", and any POSIX locale encoding or
+// modifier suffix, as in "pt_BR.UTF-8", is removed.
+// The POSIX locales "C" and "POSIX", as in "C.UTF-8",
+// name no language and become "und" (undetermined).
+// Subtags are cased as BCP 47 recommends:
+// "EN_us" becomes "en-US" and "zh-hant-tw" becomes "zh-Hant-TW".
+// Language checks that the tag is well formed, with subtags in
+// the order BCP 47 requires (language, extended language, script,
+// region, variants, extensions, private use),
+// but not that its subtags are registered.
+// If the environment value is not well formed, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, Language returns
+// the normalized form of value.
+// Language panics if value is not well formed.
+func Language(name string, value string) string {
+	v, err := parseLanguage(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseLanguage(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseLanguage(s string) (string, error) {
+	t := s
+	if i := strings.IndexAny(t, ".@"); i >= 0 {
+		t = t[:i]
+	}
+	if t == "C" || t == "POSIX" {
+		return "und", nil
+	}
+	subtags := strings.Split(strings.ReplaceAll(t, "_", "-"), "-")
+	if !wellFormedLanguage(subtags) {
+		return "", fmt.Errorf("invalid language tag %q", s)
+	}
+	return strings.Join(subtags, "-"), nil
+}
+
+// wellFormedLanguage reports whether subtags, in order, form a
+// well-formed BCP 47 language tag (RFC 5646, section 2.1),
+// and puts each subtag in its canonical case.
+// Grandfathered tags and tags made only of private use
+// subtags are not supported.
+func wellFormedLanguage(subtags []string) bool {
+	for _, st := range subtags {
+		if len(st) < 1 || len(st) > 8 || !isAlnum(st) {
+			return false
+		}
+	}
+	lang := subtags[0]
+	if len(lang) < 2 || !isAlpha(lang) {
+		return false
+	}
+	subtags[0] = strings.ToLower(lang)
+	i := 1
+	next := func(ok func(string) bool) bool {
+		return i < len(subtags) && ok(subtags[i])
+	}
+	if len(lang) <= 3 {
+		// Up to three extended language subtags.
+		for n := 0; n < 3 && next(func(st string) bool { return len(st) == 3 && isAlpha(st) }); n++ {
+			subtags[i] = strings.ToLower(subtags[i])
+			i++
+		}
+	}
+	if next(func(st string) bool { return len(st) == 4 && isAlpha(st) }) {
+		// Script.
+		subtags[i] = strings.ToUpper(subtags[i][:1]) + strings.ToLower(subtags[i][1:])
+		i++
+	}
+	if next(func(st string) bool { return len(st) == 2 && isAlpha(st) || len(st) == 3 && isDigits(st) }) {
+		// Region.
+		subtags[i] = strings.ToUpper(subtags[i])
+		i++
+	}
+	seen := make(map[string]bool)
+	for next(func(st string) bool { return len(st) >= 5 || len(st) == 4 && isDigits(st[:1]) }) {
+		// Variants, each at most once.
+		subtags[i] = strings.ToLower(subtags[i])
+		if seen[subtags[i]] {
+			return false
+		}
+		seen[subtags[i]] = true
+		i++
+	}
+	for next(func(st string) bool { return len(st) == 1 }) {
+		// Extensions and private use, each singleton at most once.
+		singleton := strings.ToLower(subtags[i])
+		if seen[singleton] {
+			return false
+		}
+		seen[singleton] = true
+		subtags[i] = singleton
+		i++
+		min := 2
+		if singleton == "x" {
+			min = 1
+		}
+		start := i
+		for next(func(st string) bool { return len(st) >= min }) {
+			subtags[i] = strings.ToLower(subtags[i])
+			i++
+		}
+		if i == start {
+			return false
+		}
+		if singleton == "x" {
+			break
+		}
+	}
+	return i == len(subtags)
+}
+
+func isAlpha(s string) bool {
+	for _, c := range []byte(s) {
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, c := range []byte(s) {
+		if !('0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	for _, c := range []byte(s) {
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Secret returns the value of the named environment variable
+// as raw bytes, in a new slice that the caller may zero
+// when it's done with the secret.
+// Secret never includes the value in diagnostic messages.
+// The process environment keeps its own copy of the value,
+// which Go provides no way to clear.
+// If name isn't in the environment or is empty, it returns value.
+func Secret(name string, value []byte) []byte {
+	if s := getenv(name); s != "" {
+		value = []byte(s)
+	}
+	return value
+}
+
+// ISODuration returns the value of the named environment variable,
+// interpreted as an ISO 8601 duration, such as "PT1H30M".
+// The W (week), D (day), H (hour), M (minute), and S (second)
+// components are supported, and any of them may have a
+// fractional part.
+// Days are taken to be exactly 24 hours and weeks 7 days.
+// Years and months have no fixed length and are rejected.
+// Each component may appear at most once, in the order above.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func ISODuration(name string, value time.Duration) time.Duration {
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = parseISODuration(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+var (
+	isoDateUnits = map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	isoTimeUnits = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+)
+
+func parseISODuration(s string) (time.Duration, error) {
+	t := s
+	neg := strings.HasPrefix(t, "-")
+	if neg || strings.HasPrefix(t, "+") {
+		t = t[1:]
+	}
+	if !strings.HasPrefix(t, "P") || len(t) == 1 {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+	t = t[1:]
+	// order holds the designators still allowed in this part,
+	// so that each appears at most once and in the standard order.
+	units, order, inTime := isoDateUnits, "WD", false
+	var d float64
+	for t != "" {
+		if t[0] == 'T' {
+			if len(t) == 1 || inTime {
+				return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+			}
+			units, order, inTime, t = isoTimeUnits, "HMS", true, t[1:]
+			continue
+		}
+		i := strings.IndexFunc(t, func(r rune) bool { return !isNumberRune(r) && r != ',' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+		unit, ok := units[t[i]]
+		if !ok {
+			if t[i] == 'Y' || t[i] == 'M' && !inTime {
+				return 0, fmt.Errorf("ISO 8601 duration %q: years and months are not supported", s)
+			}
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+		k := strings.IndexByte(order, t[i])
+		if k < 0 {
+			return 0, fmt.Errorf("ISO 8601 duration %q: %c out of order or repeated", s, t[i])
+		}
+		order = order[k+1:]
+		n, err := strconv.ParseFloat(strings.Replace(t[:i], ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+		d += n * float64(unit)
+		t = t[i+1:]
+	}
+	if d > math.MaxInt64 {
+		return 0, fmt.Errorf("ISO 8601 duration %q out of range", s)
+	}
+	if neg {
+		d = -d
+	}
+	return time.Duration(d), nil
+}
+
+// DNSName returns the value of the named environment variable,
+// interpreted as a DNS host name and normalized to lower case
+// with any single trailing dot removed.
+// A valid name has at most 253 characters, in dot-separated
+// labels of 1 to 63 letters, digits, and hyphens,
+// with no label beginning or ending with a hyphen.
+// If the environment value is not a valid name, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, DNSName returns
+// the normalized form of value.
+// DNSName panics if value is not a valid name.
+func DNSName(name string, value string) string {
+	v, err := parseDNSName(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseDNSName(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseDNSName(s string) (string, error) {
+	t := strings.ToLower(strings.TrimSuffix(s, "."))
+	if t == "" || len(t) > 253 {
+		return "", fmt.Errorf("invalid DNS name %q", s)
+	}
+	for _, label := range strings.Split(t, ".") {
+		if len(label) < 1 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("invalid DNS name %q", s)
+		}
+		for _, c := range []byte(label) {
+			if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+				return "", fmt.Errorf("invalid DNS name %q", s)
+			}
+		}
+	}
+	return t, nil
+}
+
+// StringFromFiles returns the value of the named environment variable.
+// If name isn't in the environment or is empty, it returns the
+// contents of the first of paths that exists, trimmed of leading
+// and trailing white space, or value if none of them exist.
+// If there is an error reading a file that exists, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+func StringFromFiles(name string, paths []string, value string) string {
+	if s := getenv(name); s != "" {
+		return s
+	}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	return value
+}
+
+// Header returns the value of the named environment variable,
+// interpreted as a list of HTTP header fields of the form
+// "Key: value".
+// If the value contains a newline, fields are separated by
+// newlines only, so field values may contain semicolons,
+// as in "Cookie: a=1; b=2".
+// Otherwise fields are separated by semicolons.
+// Keys and values are trimmed of leading and trailing white space,
+// and a key may appear more than once.
+// If any field has no colon, a key that isn't a valid
+// field name (an RFC 7230 token), or a value containing
+// control characters, it prints a diagnostic message
+// to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func Header(name string, value http.Header) http.Header {
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = parseHeader(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+func parseHeader(s string) (http.Header, error) {
+	sep := ";"
+	if strings.Contains(s, "\n") {
+		sep = "\n"
+	}
+	h := make(http.Header)
+	for i, f := range strings.Split(s, sep) {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(f, ":")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || !isHeaderToken(k) || !isHeaderValue(v) {
+			// Don't echo the field; header values are often credentials.
+			return nil, fmt.Errorf("malformed header field %d", i+1)
+		}
+		h.Add(k, v)
+	}
+	return h, nil
+}
+
+// isHeaderToken reports whether s is a valid header field name,
+// a token as defined by RFC 7230.
+func isHeaderToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHeaderValue reports whether s contains no control characters
+// other than horizontal tab.
+func isHeaderValue(s string) bool {
+	for _, c := range []byte(s) {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// FlagPresent reports whether the named environment variable
+// is set at all, even to the empty string.
+// Its value is ignored.
+// This implements the convention, used by NO_COLOR and others,
+// that the presence of a variable turns a feature on or off
+// regardless of its value, so NO_COLOR=0 still disables color.
+func FlagPresent(name string) bool {
+	_, ok := lookupEnv(name)
+	return ok
+}
+
+// Deadline returns the value of the named environment variable,
+// interpreted as a deadline.
+// The value is first tried as a duration (using time.ParseDuration),
+// giving a deadline that long after the current time,
+// and then as an absolute time in RFC 3339 format
+// (using time.Parse).
+// If the value is neither, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns a deadline
+// value after the current time.
+func Deadline(name string, value time.Duration) time.Time {
+	s := getenv(name)
+	if s == "" {
+		return time.Now().Add(value)
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d)
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Println(name, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", s))
+		os.Exit(1)
+	}
+	return t
+}
+
+// StringSliceCSV returns the value of the named environment variable,
+// interpreted as a single record of comma-separated fields
+// (using encoding/csv), so that a quoted field such as
+// "Doe, Jane" may contain commas.
+// Leading white space in each field is ignored.
+// If the value is not a valid CSV record or contains more than one
+// record, it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func StringSliceCSV(name string, value []string) []string {
+	if s := getenv(name); s != "" {
+		r := csv.NewReader(strings.NewReader(s))
+		r.TrimLeadingSpace = true
+		v, err := r.Read()
+		if err == nil {
+			if _, err = r.Read(); err == io.EOF {
+				err = nil
+			} else if err == nil {
+				err = fmt.Errorf("more than one CSV record")
+			}
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = v
+	}
+	return value
+}
+
+// IntHuman returns the value of the named environment variable,
+// interpreted as an int (using strconv.Atoi) after removing
+// any commas or underscores used to group digits in threes,
+// as in "1,000,000" or "1_000_000".
+// It reads a single number, not a list: a separator is accepted
+// only between groups of exactly three digits after the first
+// group, so "1,2,3" and "10,00" are errors.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func IntHuman(name string, value int) int {
+	if s := getenv(name); s != "" {
+		t, err := removeGrouping(s)
+		if err == nil {
+			value, err = strconv.Atoi(t)
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// removeGrouping removes the separators from a number whose digits
+// are grouped in threes by commas or underscores.
+func removeGrouping(s string) (string, error) {
+	i := strings.IndexAny(s, ",_")
+	if i < 0 {
+		return s, nil
+	}
+	sep := s[i : i+1]
+	digits := strings.TrimLeft(s, "+-")
+	sign := s[:len(s)-len(digits)]
+	groups := strings.Split(digits, sep)
+	for j, g := range groups {
+		n := len(g)
+		if j == 0 && (n < 1 || n > 3) || j > 0 && n != 3 || strings.Trim(g, "0123456789") != "" {
+			return "", fmt.Errorf("invalid digit grouping in %q", s)
+		}
+	}
+	return sign + strings.Join(groups, ""), nil
+}
+
+// BoolNumeric returns the value of the named environment variable,
+// interpreted as an integer (using strconv.Atoi)
+// that is true if it is nonzero, as in C.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func BoolNumeric(name string, value bool) bool {
+	if s := getenv(name); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = n != 0
+	}
+	return value
+}
+
+var countUnits = map[string]int64{
+	"":  1,
+	"k": 1e3, "K": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+	"T": 1e12,
+}
+
+// Count returns the value of the named environment variable,
+// interpreted as a non-negative count with an optional
+// decimal SI suffix: k (or K) for thousands, M for millions,
+// G for billions, or T for trillions, as in "2M" or "1.5k".
+// Any fraction remaining after scaling is truncated.
+// Unlike BytesMode, Count never uses powers of 1024.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func Count(name string, value int64) int64 {
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = parseScaled(s, countUnits)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// WritableDir returns the value of the named environment variable,
+// interpreted as the path of a directory that must exist and be
+// writable, which it checks by creating and removing a temporary file.
+// If the check fails, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value without
+// checking it, or os.TempDir() if value is empty.
+func WritableDir(name string, value string) string {
+	s := getenv(name)
+	if s == "" {
+		if value == "" {
+			value = os.TempDir()
+		}
+		return value
+	}
+	f, err := os.CreateTemp(s, ".writable-*")
+	if err != nil {
+		log.Println(name, err)
+		os.Exit(1)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return s
+}
+
+// DurationMap returns the value of the named environment variable,
+// interpreted as a comma-separated list of label=duration pairs,
+// such as "fast=1s,slow=10s", with each duration parsed
+// using time.ParseDuration.
+// Labels and durations are trimmed of leading and trailing
+// white space.
+// If any pair is malformed, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func DurationMap(name string, value map[string]time.Duration) map[string]time.Duration {
+	if s := getenv(name); s != "" {
+		m := make(map[string]time.Duration)
+		for _, e := range splitList(s) {
+			k, v, ok := strings.Cut(e, "=")
+			k = strings.TrimSpace(k)
+			if !ok || k == "" {
+				log.Println(name, fmt.Errorf("malformed entry %q", e))
+				os.Exit(1)
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil {
+				log.Println(name, fmt.Errorf("%q: %v", e, err))
+				os.Exit(1)
+			}
+			m[k] = d
+		}
+		value = m
+	}
+	return value
+}
+
+// JSONValidated decodes the value of the named environment variable
+// into v (using json.Unmarshal), then calls validate,
+// which can inspect v and report a problem with it.
+// If there is an error decoding the value or validate returns
+// an error, it prints a diagnostic message to the log
+// and calls os.Exit(1).
+// If name isn't in the environment or is empty, JSONValidated
+// leaves v unchanged and does not call validate.
+// A nil validate only decodes.
+func JSONValidated(name string, v interface{}, validate func() error) {
+	s := getenv(name)
+	if s == "" {
+		return
+	}
+	err := json.Unmarshal([]byte(s), v)
+	if err == nil && validate != nil {
+		err = validate()
+	}
+	if err != nil {
+		log.Println(name, err)
+		os.Exit(1)
+	}
+}
+
+// BoolDefaultFunc returns the value of the named environment variable,
+// interpreted as a bool (using strconv.ParseBool).
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it calls def
+// and returns its result, so the default can depend on
+// other settings.
+func BoolDefaultFunc(name string, def func() bool) bool {
+	if v, ok := lookupBool(name); ok {
+		return v
+	}
+	return def()
+}
+
+// An Endpoint is a service URL paired with the path
+// of its health check, as returned by Endpoints.
+type Endpoint struct {
+	URL    *url.URL
+	Health string
+}
+
+// Endpoints returns the value of the named environment variable,
+// interpreted as a comma-separated list of endpoints of the form
+// url|health, such as "http://a|/healthz,http://b|/status".
+// Each URL must be absolute, and each health path, if present,
+// must begin with a slash.
+// If any endpoint is malformed, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+// Endpoints panics if any element of value is malformed.
+func Endpoints(name string, value []Endpoint) []Endpoint {
+	for _, e := range value {
+		if err := checkEndpoint(e); err != nil {
+			panic(err)
+		}
+	}
+	return Slice(name, ",", value, parseEndpoint)
+}
+
+func parseEndpoint(s string) (Endpoint, error) {
+	rawURL, health, _ := strings.Cut(s, "|")
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("endpoint %q: %v", s, err)
+	}
+	e := Endpoint{URL: u, Health: strings.TrimSpace(health)}
+	if err := checkEndpoint(e); err != nil {
+		return Endpoint{}, fmt.Errorf("endpoint %q: %v", s, err)
+	}
+	return e, nil
+}
+
+func checkEndpoint(e Endpoint) error {
+	if e.URL == nil || e.URL.Scheme == "" || e.URL.Host == "" {
+		return fmt.Errorf("endpoint URL must be absolute")
+	}
+	if e.Health != "" && !strings.HasPrefix(e.Health, "/") {
+		return fmt.Errorf("health path %q must begin with /", e.Health)
+	}
+	return nil
+}
+
+// BoolExact returns the value of the named environment variable,
+// which must be exactly "true" or "false".
+// Unlike strconv.ParseBool, it rejects other forms
+// such as "1", "TRUE", or "yes".
+// If the value is anything else, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value.
+func BoolExact(name string, value bool) bool {
+	switch s := getenv(name); s {
+	case "":
+	case "true":
+		value = true
+	case "false":
+		value = false
+	default:
+		log.Println(name, fmt.Errorf("%q is neither true nor false", s))
+		os.Exit(1)
+	}
+	return value
+}
+
+var sigAlgs = map[string]string{
+	"HS256": "HS256", "HS384": "HS384", "HS512": "HS512",
+	"RS256": "RS256", "RS384": "RS384", "RS512": "RS512",
+	"ES256": "ES256", "ES384": "ES384", "ES512": "ES512",
+	"PS256": "PS256", "PS384": "PS384", "PS512": "PS512",
+	"EDDSA": "EdDSA",
+}
+
+// SigAlg returns the value of the named environment variable,
+// interpreted as a JWT signing algorithm name (RFC 7518),
+// matched without regard to case.
+// It returns the canonical spelling, such as "RS256" or "EdDSA".
+// The unsecured algorithm "none" is never accepted.
+// If the environment value is not a known algorithm, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, SigAlg returns
+// the canonical spelling of value.
+// SigAlg panics if value is not a known algorithm.
+func SigAlg(name string, value string) string {
+	v, err := parseSigAlg(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseSigAlg(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseSigAlg(s string) (string, error) {
+	alg, ok := sigAlgs[strings.ToUpper(s)]
+	if !ok {
+		return "", fmt.Errorf("unknown signing algorithm %q", s)
+	}
+	return alg, nil
+}
+
+var quantityUnits = map[string]float64{
+	"":  1,
+	"m": 1e-3,
+	"k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30,
+	"Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+// Quantity returns the value of the named environment variable,
+// interpreted as a Kubernetes resource quantity such as
+// "500m" (CPU) or "256Mi" (memory).
+// A quantity is a number followed by an optional suffix:
+// m for thousandths; k, M, G, T, P, or E for powers of 1000;
+// Ki, Mi, Gi, Ti, Pi, or Ei for powers of 1024;
+// or a decimal exponent such as e3.
+// If there is an error parsing the environment value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, Quantity returns
+// the result of parsing the given value.
+// Quantity panics if there is an error parsing the given value.
+func Quantity(name string, value string) float64 {
+	v, err := parseQuantity(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseQuantity(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseQuantity(s string) (float64, error) {
+	// splitUnit leaves a decimal exponent, as in "1e3",
+	// in num for ParseFloat.
+	num, unit := splitUnit(s)
+	f, ok := quantityUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown suffix %q in quantity %q", unit, s)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n * f, nil
+}
+
+// IntChanged is like Int, but it also reports whether
+// the value came from the environment rather than the default.
+func IntChanged(name string, value int) (int, bool) {
+	return Int(name, value), getenv(name) != ""
+}
+
+// DurationChanged is like Duration, but it also reports whether
+// the value came from the environment rather than the default.
+func DurationChanged(name string, value time.Duration) (time.Duration, bool) {
+	return Duration(name, value), getenv(name) != ""
+}
+
+// StringChanged is like String, but it also reports whether
+// the value came from the environment rather than the default.
+func StringChanged(name string, value string) (string, bool) {
+	return String(name, value), getenv(name) != ""
+}
+
+// StringSliceUnique returns the value of the named environment variable,
+// interpreted as a comma-separated list with duplicates removed.
+// Elements are trimmed of leading and trailing white space,
+// empty elements are dropped, and the first occurrence
+// of each element is kept in its original order.
+// If name isn't in the environment or is empty, it returns
+// value trimmed, with empty elements and duplicates removed
+// in the same way.
+func StringSliceUnique(name string, value []string) []string {
+	if s := getenv(name); s != "" {
+		value = splitList(s)
+	}
+	return dedup(value)
+}
+
+// dedup trims the elements of a, dropping empty ones and
+// all but the first occurrence of each.
+func dedup(a []string) []string {
+	seen := make(map[string]bool, len(a))
+	var v []string
+	for _, s := range a {
+		if s = strings.TrimSpace(s); s != "" && !seen[s] {
+			seen[s] = true
+			v = append(v, s)
+		}
+	}
+	return v
+}
+
+// Indirect returns the value of the environment variable
+// named by the value of the named environment variable.
+// For example, if DB=DB_STAGING and DB_STAGING=postgres://staging,
+// Indirect("DB", "") returns "postgres://staging".
+// Only one level of indirection is followed.
+// If the value of name is not itself the name of a variable
+// in the environment, Indirect returns that value unchanged.
+// If name isn't in the environment or is empty, it returns value.
+func Indirect(name, value string) string {
+	s := getenv(name)
+	if s == "" {
+		return value
+	}
+	if v, ok := lookupEnv(s); ok {
+		return v
+	}
+	return s
+}
+
+var objectSchemes = map[string]bool{"s3": true, "gs": true, "azblob": true}
+
+// ObjectURL returns the value of the named environment variable,
+// interpreted as an object store URL such as "s3://bucket/key"
+// (using url.Parse), split into its scheme, bucket, and key.
+// The scheme must be s3, gs, or azblob, and the bucket,
+// which is the URL's host, must not be empty.
+// The key is the URL's path without its leading slash,
+// and may be empty.
+// If the environment value is malformed, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, ObjectURL returns
+// the result of parsing the given value.
+// ObjectURL panics if the given value is malformed.
+func ObjectURL(name string, value string) (scheme, bucket, key string) {
+	scheme, bucket, key, err := parseObjectURL(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		scheme, bucket, key, err = parseObjectURL(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return scheme, bucket, key
+}
+
+func parseObjectURL(s string) (scheme, bucket, key string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !objectSchemes[u.Scheme] {
+		return "", "", "", fmt.Errorf("object URL %q: unknown scheme %q", s, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", "", fmt.Errorf("object URL %q has no bucket", s)
+	}
+	return u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// EnabledUnless returns the value of the named environment variable,
+// interpreted as a bool (using strconv.ParseBool),
+// unless the variable killSwitch is true,
+// in which case it returns false.
+// This lets one variable turn off any number of features at once.
+// A variable that isn't in the environment or is empty is false.
+// If there is an error parsing either variable, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+func EnabledUnless(name, killSwitch string) bool {
+	v, _ := lookupBool(name)
+	if kill, _ := lookupBool(killSwitch); kill {
+		return false
+	}
+	return v
+}
+
+// Concurrency returns the value of the named environment variable,
+// interpreted as a positive int (using strconv.Atoi),
+// or the word "auto", meaning runtime.GOMAXPROCS(0).
+// If there is an error parsing the value or it is not positive,
+// it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, it returns value;
+// pass runtime.GOMAXPROCS(0) for an automatic default.
+// Concurrency panics if value is not positive.
+func Concurrency(name string, value int) int {
+	if value < 1 {
+		panic(fmt.Errorf("concurrency %d is not positive", value))
+	}
+	s := getenv(name)
+	switch {
+	case s == "":
+	case strings.EqualFold(s, "auto"):
+		value = runtime.GOMAXPROCS(0)
+	default:
+		n, err := strconv.Atoi(s)
+		if err == nil && n < 1 {
+			err = fmt.Errorf("concurrency %d is not positive", n)
+		}
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+		value = n
+	}
+	return value
+}
+
+// StringSliceMax returns the value of the named environment variable,
+// interpreted as a comma-separated list of at most max elements.
+// Elements are trimmed of leading and trailing white space,
+// and empty elements are dropped.
+// If the list has more than max elements, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+// StringSliceMax panics if value has more than max elements.
+func StringSliceMax(name string, max int, value []string) []string {
+	if len(value) > max {
+		panic(fmt.Errorf("list has %d elements, more than %d", len(value), max))
+	}
+	if s := getenv(name); s != "" {
+		value = splitList(s)
+		if len(value) > max {
+			log.Println(name, fmt.Errorf("list has %d elements, more than %d", len(value), max))
+			os.Exit(1)
+		}
+	}
+	return value
+}
+
+// PoolConfig holds connection pool settings,
+// with the same meanings as the corresponding sql.DB setters.
+type PoolConfig struct {
+	MaxOpen         int
+	MaxIdle         int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Pool returns a PoolConfig read from the environment variables
+// prefix_MAX_OPEN and prefix_MAX_IDLE (as Int does) and
+// prefix_CONN_MAX_LIFETIME and prefix_CONN_MAX_IDLE_TIME
+// (as Duration does), with each field of def as the default
+// for its variable.
+// If MaxOpen is positive and MaxIdle exceeds it, Pool prints a
+// diagnostic message to the log and calls os.Exit(1).
+func Pool(prefix string, def PoolConfig) PoolConfig {
+	c := PoolConfig{
+		MaxOpen:         Int(prefix+"_MAX_OPEN", def.MaxOpen),
+		MaxIdle:         Int(prefix+"_MAX_IDLE", def.MaxIdle),
+		ConnMaxLifetime: Duration(prefix+"_CONN_MAX_LIFETIME", def.ConnMaxLifetime),
+		ConnMaxIdleTime: Duration(prefix+"_CONN_MAX_IDLE_TIME", def.ConnMaxIdleTime),
+	}
+	if c.MaxOpen > 0 && c.MaxIdle > c.MaxOpen {
+		log.Println(prefix, fmt.Errorf("max idle %d exceeds max open %d", c.MaxIdle, c.MaxOpen))
+		os.Exit(1)
+	}
+	return c
+}
+
+// TLSConfig holds common TLS settings, as returned by TLS.
+// MinVersion is one of the tls.VersionTLS constants,
+// or 0 for the crypto/tls default.
+type TLSConfig struct {
+	CertFile           string
+	KeyFile            string
+	MinVersion         uint16
+	InsecureSkipVerify bool
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLS returns a TLSConfig read from the environment variables
+// prefix_CERT_FILE and prefix_KEY_FILE (as String does),
+// prefix_MIN_VERSION (one of "1.0", "1.1", "1.2", or "1.3"),
+// and prefix_INSECURE_SKIP_VERIFY (using strconv.ParseBool),
+// with each field of def as the default for its variable.
+// If there is an error parsing a value, or only one of the
+// cert and key files is set, it prints a diagnostic message
+// to the log and calls os.Exit(1).
+func TLS(prefix string, def TLSConfig) TLSConfig {
+	c := TLSConfig{
+		CertFile:           String(prefix+"_CERT_FILE", def.CertFile),
+		KeyFile:            String(prefix+"_KEY_FILE", def.KeyFile),
+		MinVersion:         def.MinVersion,
+		InsecureSkipVerify: def.InsecureSkipVerify,
+	}
+	if s := getenv(prefix + "_MIN_VERSION"); s != "" {
+		v, ok := tlsVersions[s]
+		if !ok {
+			log.Println(prefix+"_MIN_VERSION", fmt.Errorf("unknown TLS version %q", s))
+			os.Exit(1)
+		}
+		c.MinVersion = v
+	}
+	if v, ok := lookupBool(prefix + "_INSECURE_SKIP_VERIFY"); ok {
+		c.InsecureSkipVerify = v
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		log.Println(prefix, fmt.Errorf("cert file and key file must be set together"))
+		os.Exit(1)
+	}
+	return c
+}
+
+// Sampler returns the value of the named environment variable,
+// interpreted as a sampling rate, as a function that returns true
+// with that probability each time it is called.
+// The rate is either a fraction from 0 to 1, such as "0.25",
+// or a percentage from 0 to 100 followed by '%', such as "25%".
+// The returned function is safe for concurrent use.
+// If there is an error parsing the value or it is out of range,
+// it prints a diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment, the rate is value.
+// Sampler panics if value is not between 0 and 1.
+func Sampler(name string, value float64) func() bool {
+	if !(value >= 0 && value <= 1) {
+		panic(fmt.Errorf("sampling rate %v out of range", value))
+	}
+	if s := getenv(name); s != "" {
+		var err error
+		value, err = parseRate01(s)
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Float64() < value
+	}
+}
+
+func parseRate01(s string) (float64, error) {
+	t, scale := s, 1.0
+	if strings.HasSuffix(t, "%") {
+		t, scale = strings.TrimSpace(strings.TrimSuffix(t, "%")), 100
+	}
+	f, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !(f >= 0 && f <= scale) {
+		return 0, fmt.Errorf("sampling rate %q out of range", s)
+	}
+	return f / scale, nil
+}
+
+// A Glob is a compiled path pattern, as returned by Globs.
+type Glob struct {
+	pattern string
+	segs    []string
+}
+
+// Match reports whether the slash-separated path p matches g.
+func (g Glob) Match(p string) bool {
+	return matchGlob(g.segs, strings.Split(p, "/"))
+}
+
+// String returns the pattern g was compiled from.
+func (g Glob) String() string {
+	return g.pattern
+}
+
+// Globs returns the value of the named environment variable,
+// interpreted as a comma-separated list of glob patterns,
+// such as "*.go,**/*.md", each compiled into a Glob.
+// Patterns are matched against slash-separated paths one element
+// at a time using the syntax of path.Match, except that an
+// element "**" matches zero or more path elements.
+// Elements are trimmed of leading and trailing white space.
+// If any pattern is malformed, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, Globs returns
+// the result of compiling the elements of value.
+// Globs panics if any element of value is malformed.
+func Globs(name string, value []string) []Glob {
+	v := make([]Glob, len(value))
+	for i, s := range value {
+		g, err := compileGlob(s)
+		if err != nil {
+			panic(err)
+		}
+		v[i] = g
+	}
+	return Slice(name, ",", v, compileGlob)
+}
+
+func compileGlob(s string) (Glob, error) {
+	segs := strings.Split(s, "/")
+	for _, seg := range segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return Glob{}, fmt.Errorf("glob %q: %v", s, err)
+		}
+	}
+	return Glob{pattern: s, segs: segs}, nil
+}
+
+func matchGlob(pat, elems []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			pat = pat[1:]
+			for i := 0; i <= len(elems); i++ {
+				if matchGlob(pat, elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], elems[0]); !ok {
+			return false
+		}
+		pat, elems = pat[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// BoolExplain returns the value of the named environment variable,
+// interpreted as a bool (using strconv.ParseBool),
+// along with its source: "env" if it came from the environment
+// or "default" if it is value.
+// If there is an error parsing the value, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns value.
+func BoolExplain(name string, value bool) (bool, string) {
+	if v, ok := lookupBool(name); ok {
+		return v, "env"
+	}
+	return value, "default"
+}
+
+var httpMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Methods returns the value of the named environment variable,
+// interpreted as a comma-separated list of standard HTTP methods,
+// such as "GET,POST", converted to upper case for comparison
+// with http.Request.Method.
+// Elements are trimmed of leading and trailing white space,
+// and empty elements are dropped.
+// If any element is not a standard method, it prints a
+// diagnostic message to the log and calls os.Exit(1).
+// If name isn't in the environment or is empty, it returns
+// value converted to upper case.
+// Methods panics if any element of value is not a standard method.
+func Methods(name string, value []string) []string {
+	v, err := parseMethods(value)
+	if err != nil {
+		panic(err)
+	}
+	if s := getenv(name); s != "" {
+		v, err = parseMethods(splitList(s))
+		if err != nil {
+			log.Println(name, err)
+			os.Exit(1)
+		}
+	}
+	return v
+}
+
+func parseMethods(a []string) ([]string, error) {
+	v := make([]string, len(a))
+	for i, m := range a {
+		v[i] = strings.ToUpper(m)
+		if !httpMethods[v[i]] {
+			return nil, fmt.Errorf("unknown HTTP method %q", m)
+		}
+	}
+	return v, nil
+}
+
+var (
+	frozenMu sync.RWMutex
+	frozen   map[string]string
+)
+
+// Freeze takes a snapshot of the environment.
+// Until Unfreeze is called, the functions in this package
+// read variables from the snapshot instead of from the
+// process environment, so later calls to os.Setenv or
+// os.Unsetenv have no effect on them.
+func Freeze() {
+	m := make(map[string]string)
+	for _, kv := range os.Environ() {
+		// Skip entries with no name, such as the per-drive
+		// "=C:=C:\dir" entries on Windows.
+		k, v, _ := strings.Cut(kv, "=")
+		if k == "" {
+			continue
+		}
+		k = envKey(k)
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	frozenMu.Lock()
+	frozen = m
+	frozenMu.Unlock()
+}
+
+// Unfreeze discards the snapshot taken by Freeze.
+// Subsequent calls read from the process environment again.
+func Unfreeze() {
+	frozenMu.Lock()
+	frozen = nil
+	frozenMu.Unlock()
+}
+
+func getenv(name string) string {
+	s, _ := lookupEnv(name)
+	return s
+}
+
+func lookupEnv(name string) (string, bool) {
+	frozenMu.RLock()
+	defer frozenMu.RUnlock()
+	if frozen != nil {
+		s, ok := frozen[envKey(name)]
+		return s, ok
+	}
+	return os.LookupEnv(name)
+}
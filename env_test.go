@@ -0,0 +1,416 @@
+package env
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseConstraint(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"1.0", "1.0.0", true},
+		{"1.0", "1.0.1", false},
+		{"10.0.0", "10.0.0", true},
+		{"10.0.0", "0.0.0", false},
+		{"=1.2.3", "1.2.3", true},
+		{">= 1.2", "1.2.0", true},
+		{">= 1.2", "1.1.9", false},
+		{">=1.2.0 <2.0.0", "1.9.9", true},
+		{">=1.2.0 <2.0.0", "2.0.0", false},
+		{">=1.2.0,<2.0.0", "1.5.0", true},
+		{">=1.2.0, <2.0.0", "2.1.0", false},
+		{"> 1, <= 2", "2.0.0", true},
+		{"> 1, <= 2", "1.0.0", false},
+		{">=v1.2.0", "v1.3.0-rc1", true},
+	}
+	for _, tc := range cases {
+		c, err := parseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("parseConstraint(%q) err = %v", tc.constraint, err)
+			continue
+		}
+		if got := c.Check(tc.version); got != tc.want {
+			t.Errorf("parseConstraint(%q).Check(%q) = %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestParseConstraintError(t *testing.T) {
+	for _, s := range []string{"", ">>1.0", "~1.0", ">=", "1.x", "1.2.3.4"} {
+		if _, err := parseConstraint(s); err == nil {
+			t.Errorf("parseConstraint(%q) err = nil, want error", s)
+		}
+	}
+}
+
+func TestRemoveGrouping(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"1000000", "1000000"},
+		{"1,000,000", "1000000"},
+		{"1_000", "1000"},
+		{"-12,345", "-12345"},
+		{"999,999", "999999"},
+	}
+	for _, tc := range cases {
+		got, err := removeGrouping(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("removeGrouping(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestRemoveGroupingError(t *testing.T) {
+	for _, s := range []string{"1,2,3", "10,00", "1__0", "1__000", "1,000_000", ",000", "1000,000", "1,00a", "1,"} {
+		if got, err := removeGrouping(s); err == nil {
+			t.Errorf("removeGrouping(%q) = %q, want error", s, got)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	cases := []struct {
+		in   string
+		want http.Header
+	}{
+		{"X-A: 1; X-B: 2", http.Header{"X-A": {"1"}, "X-B": {"2"}}},
+		{"x-a: 1; X-A: 2;", http.Header{"X-A": {"1", "2"}}},
+		{"Accept: text/html; q=0.9\n", http.Header{"Accept": {"text/html; q=0.9"}}},
+		{"Cookie: a=1; b=2\nX-B: c", http.Header{"Cookie": {"a=1; b=2"}, "X-B": {"c"}}},
+		{"X-Odd_Name.1: a\tb", http.Header{"X-Odd_name.1": {"a\tb"}}},
+	}
+	for _, tc := range cases {
+		got, err := parseHeader(tc.in)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseHeader(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseHeaderError(t *testing.T) {
+	for _, s := range []string{
+		"X-A", "X-A: 1; nocolon", ": v", "Cookie: a=1\nbad",
+		"Bad Key: v", "X(A): v", "X-A\x00: v", "Ké: v",
+		"X-A: a\x00b", "X-A: a\x7fb", "X-A: a\rb",
+	} {
+		if got, err := parseHeader(s); err == nil {
+			t.Errorf("parseHeader(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestParseWeighted(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Weighted
+	}{
+		{"a=3", Weighted{"a", 3}},
+		{"a", Weighted{"a", 1}},
+		{" a = 0 ", Weighted{"a", 0}},
+	}
+	for _, tc := range cases {
+		got, err := parseWeighted(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseWeighted(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseWeightedError(t *testing.T) {
+	for _, s := range []string{"", "=3", "x=-3", "x=y", "x="} {
+		if got, err := parseWeighted(s); err == nil {
+			t.Errorf("parseWeighted(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	t.Setenv("ENV_TEST_FREEZE", "a")
+	Freeze()
+	defer Unfreeze()
+	os.Setenv("ENV_TEST_FREEZE", "b")
+	if got := String("ENV_TEST_FREEZE", ""); got != "a" {
+		t.Errorf("frozen String = %q, want %q", got, "a")
+	}
+	if got := String("", "def"); got != "def" {
+		t.Errorf("frozen String(\"\") = %q, want %q", got, "def")
+	}
+	Unfreeze()
+	if got := String("ENV_TEST_FREEZE", ""); got != "b" {
+		t.Errorf("unfrozen String = %q, want %q", got, "b")
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"en-US", "en-US"},
+		{"EN_us", "en-US"},
+		{"pt_BR.UTF-8", "pt-BR"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"de_DE@euro", "de-DE"},
+		{"C", "und"},
+		{"C.UTF-8", "und"},
+		{"POSIX", "und"},
+		{"zh-yue-HK", "zh-yue-HK"},
+		{"sl-rozaj-biske", "sl-rozaj-biske"},
+		{"de-CH-1901", "de-CH-1901"},
+		{"es-419", "es-419"},
+		{"en-US-u-CA-gregory", "en-US-u-ca-gregory"},
+		{"en-a-bbb-x-A-CCC", "en-a-bbb-x-a-ccc"},
+	}
+	for _, tc := range cases {
+		got, err := parseLanguage(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseLanguage(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseLanguageError(t *testing.T) {
+	for _, s := range []string{
+		"", "e", "e1", "en-", "en--US", "en-US-US", "en-Latn-Latn",
+		"en-US-Latn", "de-1901-1901", "en-a", "en-a-b", "en-u-ca-u-nu",
+		"en-x", "en-abcdefghi", "en-US-ab", "x-private",
+	} {
+		if got, err := parseLanguage(s); err == nil {
+			t.Errorf("parseLanguage(%q) = %q, want error", s, got)
+		}
+	}
+}
+
+func TestStringSliceUnique(t *testing.T) {
+	got := StringSliceUnique("ENV_TEST_UNSET", []string{"a", "b", " a", "", "c"})
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StringSliceUnique default = %q, want %q", got, want)
+	}
+	t.Setenv("ENV_TEST_UNIQUE", "x, y,,x ,z")
+	got = StringSliceUnique("ENV_TEST_UNIQUE", nil)
+	want = []string{"x", "y", "z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StringSliceUnique = %q, want %q", got, want)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT1H30M", 90 * time.Minute},
+		{"PT45S", 45 * time.Second},
+		{"PT0.5S", 500 * time.Millisecond},
+		{"PT1,5H", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"P1W2DT1H2M3S", 9*24*time.Hour + time.Hour + 2*time.Minute + 3*time.Second},
+		{"-PT2M", -2 * time.Minute},
+		{"+PT2M", 2 * time.Minute},
+	}
+	for _, tc := range cases {
+		got, err := parseISODuration(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseISODuration(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseISODurationError(t *testing.T) {
+	for _, s := range []string{
+		"", "P", "PT", "1H", "PT1", "PTH",
+		"PT1S2H", "PT1H1H", "PT1M1H", "P1D1W", "P1D1D", "P1DT1HT1M",
+		"P1Y", "P1M", "1h30m",
+		"--P1D", "-+-P1D", "+-P1D",
+	} {
+		if got, err := parseISODuration(s); err == nil {
+			t.Errorf("parseISODuration(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestSplitUnit(t *testing.T) {
+	cases := []struct {
+		in, num, unit string
+	}{
+		{"250ms", "250", "ms"},
+		{"250 ms", "250", "ms"},
+		{"1.5k", "1.5", "k"},
+		{"-5s", "-5", "s"},
+		{"5m2", "5", "m2"},
+		{"3s-1", "3", "s-1"},
+		{"1e3", "1e3", ""},
+		{"2.5E-2x", "2.5E-2", "x"},
+		{"1E", "1", "E"},
+		{"1Ei", "1", "Ei"},
+		{"42", "42", ""},
+		{"ms", "", "ms"},
+	}
+	for _, tc := range cases {
+		num, unit := splitUnit(tc.in)
+		if num != tc.num || unit != tc.unit {
+			t.Errorf("splitUnit(%q) = %q, %q, want %q, %q", tc.in, num, unit, tc.num, tc.unit)
+		}
+	}
+}
+
+func TestParseScaledCount(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"2M", 2000000},
+		{"1.5k", 1500},
+		{"9007199254740993", 9007199254740993},
+		{"9223372036854775807", math.MaxInt64},
+		{"9223372036854k", 9223372036854000},
+		{"9223372T", 9223372000000000000},
+	}
+	for _, tc := range cases {
+		got, err := parseScaled(tc.in, countUnits)
+		if err != nil || got != tc.want {
+			t.Errorf("parseScaled(%q, countUnits) = %d, %v, want %d", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseScaledCountError(t *testing.T) {
+	for _, s := range []string{"", "x", "-1", "9223372036854775808", "9223373T", "1x", "1.5X"} {
+		if got, err := parseScaled(s, countUnits); err == nil {
+			t.Errorf("parseScaled(%q, countUnits) = %d, want error", s, got)
+		}
+	}
+}
+
+func TestParseScaledBytes(t *testing.T) {
+	cases := []struct {
+		in   string
+		mode ByteMode
+		want int64
+	}{
+		{"512", SI, 512},
+		{"1MB", SI, 1000000},
+		{"1kB", SI, 1000},
+		{"1.5GiB", IEC, 3 << 29},
+		{"1KiB", IEC, 1024},
+		{"9007199254740993B", SI, 9007199254740993},
+		{"9223372036854775807", SI, math.MaxInt64},
+		{"9223372036854775807", IEC, math.MaxInt64},
+		{"8EB", SI, 8000000000000000000},
+		{"7EiB", IEC, 7 << 60},
+	}
+	for _, tc := range cases {
+		got, err := parseScaled(tc.in, byteUnits[tc.mode])
+		if err != nil || got != tc.want {
+			t.Errorf("parseScaled(%q, byteUnits[%d]) = %d, %v, want %d", tc.in, tc.mode, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseScaledBytesError(t *testing.T) {
+	cases := []struct {
+		in   string
+		mode ByteMode
+	}{
+		{"1MB", IEC},
+		{"1MiB", SI},
+		{"9223372036854775808", SI},
+		{"10EB", SI},
+		{"8EiB", IEC},
+		{"9.3EB", SI},
+	}
+	for _, tc := range cases {
+		if got, err := parseScaled(tc.in, byteUnits[tc.mode]); err == nil {
+			t.Errorf("parseScaled(%q, byteUnits[%d]) = %d, want error", tc.in, tc.mode, got)
+		}
+	}
+}
+
+func TestEvalBoolExpr(t *testing.T) {
+	t.Setenv("ENV_TEST_T", "true")
+	t.Setenv("ENV_TEST_F", "0")
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"ENV_TEST_T", true},
+		{"ENV_TEST_UNSET", false},
+		{"!ENV_TEST_F", true},
+		{"!!ENV_TEST_T", true},
+		{"ENV_TEST_T || ENV_TEST_F && ENV_TEST_F", true},    // && binds tighter than ||
+		{"(ENV_TEST_T || ENV_TEST_F) && ENV_TEST_F", false}, // parentheses override
+		{"ENV_TEST_F && ENV_TEST_F || ENV_TEST_T", true},
+		{"!ENV_TEST_T && ENV_TEST_F", false}, // ! binds tighter than &&
+		{"!(ENV_TEST_T && ENV_TEST_F)", true},
+		{"!ENV_TEST_F && ENV_TEST_T", true},
+		{" ( ENV_TEST_T )\t", true},
+	}
+	for _, tc := range cases {
+		got, err := evalBoolExpr(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("evalBoolExpr(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestEvalBoolExprError(t *testing.T) {
+	t.Setenv("A", "true")
+	t.Setenv("B", "true")
+	t.Setenv("BAD", "maybe")
+	for _, s := range []string{
+		"A &&", "()", "A B", "A & B", "A | B", "(A", "A)", "!", "1A",
+		"A || BAD", // operands are all evaluated, so BAD is reported
+	} {
+		if got, err := evalBoolExpr(s); err == nil {
+			t.Errorf("evalBoolExpr(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"**/*.md", "c.md", true},
+		{"**/*.md", "a/b/c.md", true},
+		{"**/*.md", "a/c.go", false},
+		{"*.go", "x.go", true},
+		{"*.go", "a/x.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x", false},
+		{"a/**", "a", true},
+		{"a/**", "a/x/y", true},
+		{"a/[bc]?", "a/cd", true},
+	}
+	for _, tc := range cases {
+		g, err := compileGlob(tc.pattern)
+		if err != nil {
+			t.Errorf("compileGlob(%q) err = %v", tc.pattern, err)
+			continue
+		}
+		if got := g.Match(tc.path); got != tc.want {
+			t.Errorf("compileGlob(%q).Match(%q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestCompileGlobError(t *testing.T) {
+	for _, s := range []string{"a/[", "[", "**/[a-", "a\\"} {
+		if _, err := compileGlob(s); err == nil {
+			t.Errorf("compileGlob(%q) err = nil, want error", s)
+		}
+	}
+}
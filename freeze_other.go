@@ -0,0 +1,8 @@
+//go:build !windows
+
+package env
+
+// envKey returns the key under which Freeze stores the variable name.
+func envKey(name string) string {
+	return name
+}
@@ -0,0 +1,9 @@
+package env
+
+import "strings"
+
+// envKey returns the key under which Freeze stores the variable name.
+// Windows variable names are case-insensitive.
+func envKey(name string) string {
+	return strings.ToUpper(name)
+}
@@ -1 +1,3 @@
 module "github.com/kr/env"
+
+go 1.19
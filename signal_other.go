@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package env
+
+import "os"
+
+var signalNames = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGKILL": os.Kill,
+}